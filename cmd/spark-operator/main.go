@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/liyinan926/spark-operator/pkg/initializer"
+	"github.com/liyinan926/spark-operator/pkg/webhook"
+
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	masterURL               = flag.String("master", "", "The address of the Kubernetes API server; only required if out-of-cluster")
+	kubeConfig              = flag.String("kubeconfig", "", "Path to a kubeconfig; only required if out-of-cluster")
+	controllerMode          = flag.String("controller-mode", "initializer", "The mechanism used to mutate Spark pods: initializer or webhook")
+	namespace               = flag.String("namespace", "", "The Kubernetes namespace to restrict pod watching to; defaults to all namespaces")
+	initializerThreads      = flag.Int("initializer-threads", 10, "Number of worker threads used by the pod initializer controller")
+	podDeadline             = flag.Duration("pod-deadline", 60*time.Second, "Maximum time the initializer spends mutating a single pod before it removes itself without applying any mutation")
+	failurePolicy           = flag.String("failure-policy", "Ignore", "What to do with a pod when a mutation step fails: Ignore or Fail")
+	maxRetries              = flag.Int("max-retries", 5, "Number of times a pod is retried after a sync error before it is dropped from the queue")
+	metricsAddr             = flag.String("metrics-addr", ":10254", "The address the initializer's Prometheus metrics are served on")
+	webhookPort             = flag.Int("webhook-port", 8080, "The port the admission webhook server listens on")
+	webhookServiceNamespace = flag.String("webhook-svc-namespace", "default", "The namespace of the Service fronting the admission webhook")
+	webhookServiceName      = flag.String("webhook-svc-name", "spark-webhook", "The name of the Service fronting the admission webhook")
+)
+
+func main() {
+	flag.Parse()
+
+	restConfig, err := buildConfig(*masterURL, *kubeConfig)
+	if err != nil {
+		glog.Fatalf("failed to build the Kubernetes client configuration: %v", err)
+	}
+
+	kubeClient, err := clientset.NewForConfig(restConfig)
+	if err != nil {
+		glog.Fatalf("failed to create a Kubernetes client: %v", err)
+	}
+
+	stopCh := make(chan struct{})
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-signalCh
+		close(stopCh)
+	}()
+
+	switch *controllerMode {
+	case "initializer":
+		runInitializer(kubeClient, stopCh)
+	case "webhook":
+		runWebhook(kubeClient, stopCh)
+	default:
+		glog.Fatalf("invalid --controller-mode %q: must be initializer or webhook", *controllerMode)
+	}
+}
+
+func runInitializer(kubeClient clientset.Interface, stopCh <-chan struct{}) {
+	go func() {
+		if err := initializer.ServeMetrics(*metricsAddr); err != nil {
+			glog.Errorf("the initializer metrics server failed: %v", err)
+		}
+	}()
+
+	policy, err := initializer.ParseFailurePolicy(*failurePolicy)
+	if err != nil {
+		glog.Fatalf("invalid --failure-policy: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	initializerConfig := initializer.Config{
+		Namespace:     *namespace,
+		PodDeadline:   *podDeadline,
+		FailurePolicy: policy,
+		MaxRetries:    *maxRetries,
+	}
+	sparkPodInitializer := initializer.New(kubeClient, initializerConfig)
+	go sparkPodInitializer.Run(*initializerThreads, stopCh, errCh)
+
+	if err := <-errCh; err != nil {
+		glog.Fatalf("the Spark Pod initializer failed: %v", err)
+	}
+}
+
+func runWebhook(kubeClient clientset.Interface, stopCh <-chan struct{}) {
+	wc, err := webhook.New(kubeClient, *webhookServiceNamespace, *webhookServiceName, *webhookPort)
+	if err != nil {
+		glog.Fatalf("failed to create the Spark Pod admission webhook: %v", err)
+	}
+
+	if err := wc.Start(stopCh); err != nil {
+		glog.Fatalf("the Spark Pod admission webhook failed: %v", err)
+	}
+}
+
+func buildConfig(masterURL, kubeConfig string) (*rest.Config, error) {
+	if kubeConfig != "" {
+		return clientcmd.BuildConfigFromFlags(masterURL, kubeConfig)
+	}
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the in-cluster configuration: %v", err)
+	}
+	return config, nil
+}
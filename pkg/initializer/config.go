@@ -0,0 +1,80 @@
+package initializer
+
+import (
+	"fmt"
+	"time"
+)
+
+// FailurePolicy determines what SparkPodInitializer does with a Pod when one of the
+// mutation steps in syncSparkPod fails.
+type FailurePolicy string
+
+const (
+	// FailurePolicyIgnore logs the error, removes the initializer from the Pod so it can
+	// proceed uninitialized, and lets the Pod continue.
+	FailurePolicyIgnore FailurePolicy = "Ignore"
+	// FailurePolicyFail deletes the Pod outright and records an Event explaining why.
+	FailurePolicyFail FailurePolicy = "Fail"
+)
+
+const (
+	// defaultPodDeadline is the default amount of time syncSparkPod is allowed to spend
+	// initializing a single Pod before it abandons the mutation steps.
+	defaultPodDeadline = 60 * time.Second
+	// defaultMaxRetries is the default number of times a Pod key is retried after a sync
+	// error before it is dropped from the queue.
+	defaultMaxRetries = 5
+)
+
+// Config carries the tunables of a SparkPodInitializer.
+type Config struct {
+	// Namespace restricts the Pods watched and listed to the given namespace, or to all
+	// namespaces if empty.
+	Namespace string
+	// PodDeadline is the maximum amount of time syncSparkPod is allowed to spend
+	// initializing a single Pod before it abandons the mutation steps, removes the
+	// initializer from the Pod without applying any of the mutations, and records an
+	// Event saying they were skipped.
+	PodDeadline time.Duration
+	// FailurePolicy determines how a mutation error is handled. Defaults to
+	// FailurePolicyIgnore.
+	FailurePolicy FailurePolicy
+	// MaxRetries is the number of times a Pod key is retried after a sync error before it
+	// is dropped from the queue and an Event is recorded. Defaults to defaultMaxRetries.
+	MaxRetries int
+}
+
+// ParseFailurePolicy validates a --failure-policy flag value, returning the empty string
+// (which withDefaults maps to FailurePolicyIgnore), FailurePolicyIgnore, or
+// FailurePolicyFail, and an error for anything else so a typo'd flag fails fast at
+// startup instead of silently behaving as FailurePolicyIgnore.
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	switch FailurePolicy(s) {
+	case "", FailurePolicyIgnore, FailurePolicyFail:
+		return FailurePolicy(s), nil
+	default:
+		return "", fmt.Errorf("invalid failure policy %q: must be %s or %s", s, FailurePolicyIgnore, FailurePolicyFail)
+	}
+}
+
+// DefaultConfig returns a Config with the recommended default tunables.
+func DefaultConfig() Config {
+	return Config{
+		PodDeadline:   defaultPodDeadline,
+		FailurePolicy: FailurePolicyIgnore,
+		MaxRetries:    defaultMaxRetries,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	if c.PodDeadline <= 0 {
+		c.PodDeadline = defaultPodDeadline
+	}
+	if c.FailurePolicy == "" {
+		c.FailurePolicy = FailurePolicyIgnore
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = defaultMaxRetries
+	}
+	return c
+}
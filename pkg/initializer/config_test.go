@@ -0,0 +1,87 @@
+package initializer
+
+import "testing"
+
+func TestConfigWithDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Config
+		want Config
+	}{
+		{
+			name: "zero value gets all defaults",
+			in:   Config{},
+			want: Config{
+				PodDeadline:   defaultPodDeadline,
+				FailurePolicy: FailurePolicyIgnore,
+				MaxRetries:    defaultMaxRetries,
+			},
+		},
+		{
+			name: "explicit values are preserved",
+			in: Config{
+				Namespace:     "spark",
+				PodDeadline:   5,
+				FailurePolicy: FailurePolicyFail,
+				MaxRetries:    1,
+			},
+			want: Config{
+				Namespace:     "spark",
+				PodDeadline:   5,
+				FailurePolicy: FailurePolicyFail,
+				MaxRetries:    1,
+			},
+		},
+		{
+			name: "negative MaxRetries falls back to the default",
+			in:   Config{MaxRetries: -1},
+			want: Config{
+				PodDeadline:   defaultPodDeadline,
+				FailurePolicy: FailurePolicyIgnore,
+				MaxRetries:    defaultMaxRetries,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.in.withDefaults()
+			if got != test.want {
+				t.Errorf("withDefaults() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    FailurePolicy
+		wantErr bool
+	}{
+		{name: "empty string is valid", in: "", want: ""},
+		{name: "Ignore is valid", in: "Ignore", want: FailurePolicyIgnore},
+		{name: "Fail is valid", in: "Fail", want: FailurePolicyFail},
+		{name: "lowercase fail is invalid", in: "fail", wantErr: true},
+		{name: "garbage is invalid", in: "bogus", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseFailurePolicy(test.in)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error for %q, got none", test.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", test.in, err)
+			}
+			if got != test.want {
+				t.Errorf("ParseFailurePolicy(%q) = %q, want %q", test.in, got, test.want)
+			}
+		})
+	}
+}
@@ -8,22 +8,24 @@ import (
 
 	"github.com/golang/glog"
 
-	"github.com/liyinan926/spark-operator/pkg/config"
-	"github.com/liyinan926/spark-operator/pkg/secret"
+	"github.com/liyinan926/spark-operator/pkg/mutation"
 
 	"k8s.io/api/admissionregistration/v1alpha1"
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 )
 
@@ -38,54 +40,74 @@ const (
 	sparkDriverRole = "driver"
 	// SparkExecutorRole is the value of the spark-role label assigned to Spark executor Pods.
 	sparkExecutorRole = "executor"
+	// resyncInterval is the interval at which the shared informer resyncs its store and
+	// re-delivers known Pods to the registered event handlers.
+	resyncInterval = 30 * time.Second
 )
 
 // SparkPodInitializer watches uninitialized Spark driver and executor pods and modifies pod specs
 // based on certain annotations on the pods. For example, it is responsible for mounting
-// user-specified secrets and ConfigMaps into the driver and executor pods.
+// user-specified secrets, ConfigMaps and other volumes (PVCs, emptyDir, hostPath,
+// projected) into the driver and executor pods, and for injecting sidecar and init
+// containers requested through pod annotations.
 type SparkPodInitializer struct {
 	// Client to the Kubernetes API.
 	kubeClient clientset.Interface
-	// sparkPodController is a controller for listing uninitialized Spark Pods.
-	sparkPodController cache.Controller
+	// informerFactory is the shared informer factory the Pod informer below is built
+	// from, started once from Run so its cache can eventually be shared with other
+	// controllers, e.g. a SparkApplication CRD controller.
+	informerFactory informers.SharedInformerFactory
+	// podInformer is the shared informer for Spark Pods, scoped to the configured
+	// namespace and to Pods carrying the spark-role label.
+	podInformer cache.SharedIndexInformer
+	// podLister is backed by the podInformer's store and serves syncSparkPod reads
+	// without hitting the API server.
+	podLister corelisters.PodLister
 	// A queue of uninitialized Pods that need to be processed by this initializer controller.
 	queue workqueue.RateLimitingInterface
 	// To allow injection of syncReplicaSet for testing.
 	syncHandler func(key string) (*apiv1.Pod, error)
+	// config holds the initializer's tunables: the per-Pod deadline, the failure policy,
+	// and the queue's max-retry count.
+	config Config
+	// eventBroadcaster and recorder are used to record Events on Pods the initializer
+	// times out on, fails to initialize, or gives up on after config.MaxRetries.
+	eventBroadcaster record.EventBroadcaster
+	recorder         record.EventRecorder
 }
 
-// New creates a new instance of Initializer.
-func New(kubeClient clientset.Interface) *SparkPodInitializer {
+// New creates a new instance of Initializer using config for its tunables.
+func New(kubeClient clientset.Interface, config Config) *SparkPodInitializer {
+	config = config.withDefaults()
+
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(glog.Infof)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: kubeClient.CoreV1().Events(""),
+	})
+
 	initializer := &SparkPodInitializer{
-		kubeClient: kubeClient,
-		queue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "spark-initializer"),
+		kubeClient:       kubeClient,
+		queue:            workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "spark-initializer"),
+		config:           config,
+		eventBroadcaster: eventBroadcaster,
+		recorder:         eventBroadcaster.NewRecorder(scheme.Scheme, apiv1.EventSource{Component: "spark-pod-initializer"}),
 	}
 	initializer.syncHandler = initializer.syncSparkPod
 
-	restClient := kubeClient.CoreV1().RESTClient()
-	watchlist := cache.NewListWatchFromClient(restClient, "pods", apiv1.NamespaceAll, fields.Everything())
-	// Wrap the returned watchlist to workaround the inability to include
-	// the `IncludeUninitialized` list option when setting up watch clients.
-	includeUninitializedWatchlist := &cache.ListWatch{
-		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-			options.IncludeUninitialized = true
-			return watchlist.List(options)
-		},
-		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-			options.IncludeUninitialized = true
-			return watchlist.Watch(options)
-		},
+	tweakListOptions := func(options *metav1.ListOptions) {
+		options.LabelSelector = sparkRoleLabel
+		options.IncludeUninitialized = true
 	}
-
-	_, initializer.sparkPodController = cache.NewInformer(
-		includeUninitializedWatchlist,
-		&apiv1.Pod{},
-		30*time.Second,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc:    initializer.onPodAdded,
-			DeleteFunc: initializer.onPodDeleted,
-		},
-	)
+	initializer.informerFactory = informers.NewFilteredSharedInformerFactory(
+		kubeClient, resyncInterval, config.Namespace, tweakListOptions)
+	podInformer := initializer.informerFactory.Core().V1().Pods()
+	initializer.podInformer = podInformer.Informer()
+	initializer.podLister = podInformer.Lister()
+	initializer.podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    initializer.onPodAdded,
+		DeleteFunc: initializer.onPodDeleted,
+	})
 
 	return initializer
 }
@@ -94,6 +116,7 @@ func New(kubeClient clientset.Interface) *SparkPodInitializer {
 func (ic *SparkPodInitializer) Run(workers int, stopCh <-chan struct{}, errCh chan<- error) {
 	defer utilruntime.HandleCrash()
 	defer ic.queue.ShutDown()
+	defer ic.eventBroadcaster.Shutdown()
 
 	glog.Info("Starting the Spark Pod initializer")
 	defer glog.Info("Stopping the Spark Pod initializer")
@@ -105,8 +128,12 @@ func (ic *SparkPodInitializer) Run(workers int, stopCh <-chan struct{}, errCh ch
 		return
 	}
 
-	glog.Info("Starting the Pod controller")
-	go ic.sparkPodController.Run(stopCh)
+	glog.Info("Starting the Pod informer factory")
+	ic.informerFactory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, ic.podInformer.HasSynced) {
+		errCh <- fmt.Errorf("timed out waiting for the Pod informer cache to sync")
+		return
+	}
 
 	glog.Info("Starting the workers of the Spark Pod initializer controller")
 	// Start up worker threads.
@@ -206,6 +233,7 @@ func (ic *SparkPodInitializer) processNextItem() bool {
 		return false
 	}
 	defer ic.queue.Done(key)
+	queueDepth.Set(float64(ic.queue.Len()))
 
 	_, err := ic.syncHandler(key.(string))
 	if err == nil {
@@ -218,11 +246,24 @@ func (ic *SparkPodInitializer) processNextItem() bool {
 	// There was a failure so be sure to report it. This method allows for pluggable error handling
 	// which can be used for things like cluster-monitoring
 	utilruntime.HandleError(fmt.Errorf("failed to sync pod %q: %v", key, err))
-	// Since we failed, we should requeue the item to work on later.  This method will add a backoff
-	// to avoid hotlooping on particular items (they're probably still not going to work right away)
-	// and overall controller protection (everything I've done is broken, this controller needs to
-	// calm down or it can starve other useful work) cases.
-	ic.queue.AddRateLimited(key)
+
+	if ic.queue.NumRequeues(key) < ic.config.MaxRetries {
+		// Since we failed, we should requeue the item to work on later.  This method will add a backoff
+		// to avoid hotlooping on particular items (they're probably still not going to work right away)
+		// and overall controller protection (everything I've done is broken, this controller needs to
+		// calm down or it can starve other useful work) cases.
+		ic.queue.AddRateLimited(key)
+		return true
+	}
+
+	glog.Errorf("giving up on pod %q after %d retries: %v", key, ic.config.MaxRetries, err)
+	if namespace, name, nameErr := getNamespaceName(key.(string)); nameErr == nil {
+		if pod, getErr := ic.kubeClient.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{}); getErr == nil {
+			ic.recorder.Eventf(pod, apiv1.EventTypeWarning, "MaxRetriesExceeded",
+				"giving up initializing pod after %d retries: %v", ic.config.MaxRetries, err)
+		}
+	}
+	ic.queue.Forget(key)
 
 	return true
 }
@@ -230,17 +271,30 @@ func (ic *SparkPodInitializer) processNextItem() bool {
 // syncSparkPod does the actual processing of the given Spark Pod.
 func (ic *SparkPodInitializer) syncSparkPod(key string) (*apiv1.Pod, error) {
 	namespace, name, err := getNamespaceName(key)
-	pod, err := ic.kubeClient.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
 	if err != nil {
-		if errors.IsNotFound(err) {
-			return nil, nil
-		}
 		return nil, err
 	}
 
+	pod, err := ic.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		// Cache miss: fall back to the API server before giving up on the Pod.
+		pod, err = ic.kubeClient.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+
 	glog.Infof("Processing Spark %s pod %s", pod.Labels[sparkRoleLabel], pod.Name)
 
-	// Make a copy.
+	// Make a copy. This copy is never touched by the mutation pipeline -- it is only used
+	// as the base for the timeout path below, so that a mutation goroutine abandoned after
+	// a deadline can never race with the rest of syncSparkPod over its fields.
 	copyObj, err := runtime.NewScheme().DeepCopy(pod)
 	if err != nil {
 		return nil, err
@@ -249,17 +303,101 @@ func (ic *SparkPodInitializer) syncSparkPod(key string) (*apiv1.Pod, error) {
 	if len(modifiedPod.Spec.Containers) <= 0 {
 		return nil, fmt.Errorf("no container found in Pod %s", modifiedPod.Name)
 	}
-	// We assume that the first container is the Spark container.
-	appContainer := &modifiedPod.Spec.Containers[0]
+	role := pod.Labels[sparkRoleLabel]
+
+	start := time.Now()
+	mutatedPod, timedOut, mutateErr := ic.runMutations(pod)
+	syncLatency.WithLabelValues(role).Observe(time.Since(start).Seconds())
+
+	if timedOut {
+		glog.Warningf("timed out after %s initializing pod %s, skipping all mutations", ic.config.PodDeadline, pod.Name)
+		ic.recorder.Eventf(pod, apiv1.EventTypeWarning, "InitializationTimeout",
+			"timed out after %s, no mutations were applied", ic.config.PodDeadline)
+		initializerRemovals.WithLabelValues(role, "timeout").Inc()
+		removeSelf(modifiedPod)
+		patched, err := patchPod(pod, modifiedPod, ic.kubeClient)
+		if err != nil {
+			patchErrors.Inc()
+		}
+		return patched, err
+	}
+
+	if mutateErr != nil {
+		return ic.handleMutationError(pod, mutatedPod, role, mutateErr)
+	}
 
-	// Perform the initialization tasks.
-	addOwnerReference(modifiedPod)
-	handleConfigMaps(modifiedPod, appContainer)
-	handleSecrets(modifiedPod, appContainer)
 	// Remove this initializer from the list of pending initializer and update the Pod.
+	initializerRemovals.WithLabelValues(role, "completed").Inc()
+	removeSelf(mutatedPod)
+
+	patched, err := patchPod(pod, mutatedPod, ic.kubeClient)
+	if err != nil {
+		patchErrors.Inc()
+	}
+	return patched, err
+}
+
+// runMutations runs the annotation-driven mutation steps against a copy of pod owned
+// exclusively by a dedicated goroutine, and enforces ic.config.PodDeadline on the whole
+// pipeline. If the deadline elapses first, runMutations returns immediately with timedOut
+// set; the goroutine is left to finish on its own time, but since it only ever writes to
+// the copy it privately owns -- never to pod, or to anything the caller goes on to read --
+// an abandoned run cannot race with the rest of syncSparkPod.
+func (ic *SparkPodInitializer) runMutations(pod *apiv1.Pod) (mutatedPod *apiv1.Pod, timedOut bool, err error) {
+	copyObj, err := runtime.NewScheme().DeepCopy(pod)
+	if err != nil {
+		return nil, false, err
+	}
+	workingPod := copyObj.(*apiv1.Pod)
+	// We assume that the first container is the Spark container.
+	appContainer := &workingPod.Spec.Containers[0]
+
+	done := make(chan error, 1)
+	go func() {
+		if err := mutation.AddOwnerReference(workingPod); err != nil {
+			done <- err
+			return
+		}
+		mutation.HandleConfigMaps(workingPod, appContainer)
+		mutation.HandleSecrets(workingPod, appContainer)
+		if err := mutation.HandleVolumes(workingPod, appContainer); err != nil {
+			done <- err
+			return
+		}
+		done <- mutation.HandleSidecars(workingPod, appContainer, ic.kubeClient)
+	}()
+
+	select {
+	case err := <-done:
+		return workingPod, false, err
+	case <-time.After(ic.config.PodDeadline):
+		return nil, true, nil
+	}
+}
+
+// handleMutationError applies ic.config.FailurePolicy to a Pod whose mutation pipeline
+// returned an error.
+func (ic *SparkPodInitializer) handleMutationError(pod, modifiedPod *apiv1.Pod, role string, mutateErr error) (*apiv1.Pod, error) {
+	if ic.config.FailurePolicy == FailurePolicyFail {
+		glog.Errorf("failing pod %s due to initialization error: %v", pod.Name, mutateErr)
+		ic.recorder.Eventf(pod, apiv1.EventTypeWarning, "InitializationFailed", "deleting pod: %v", mutateErr)
+		initializerRemovals.WithLabelValues(role, "failed").Inc()
+		if err := ic.kubeClient.CoreV1().Pods(pod.Namespace).Delete(pod.Name, metav1.NewDeleteOptions(0)); err != nil {
+			return nil, fmt.Errorf("failed to delete pod %s after initialization error: %v", pod.Name, err)
+		}
+		return nil, nil
+	}
+
+	glog.Errorf("ignoring initialization error for pod %s: %v", pod.Name, mutateErr)
+	ic.recorder.Eventf(pod, apiv1.EventTypeWarning, "InitializationError", "ignoring error and proceeding: %v", mutateErr)
+	initializerRemovals.WithLabelValues(role, "error").Inc()
 	removeSelf(modifiedPod)
 
-	return patchPod(pod, modifiedPod, ic.kubeClient)
+	patched, err := patchPod(pod, modifiedPod, ic.kubeClient)
+	if err != nil {
+		patchErrors.Inc()
+	}
+	return patched, err
 }
 
 // onPodAdded is the callback function called when an event for a new Pod is informed.
@@ -344,59 +482,6 @@ func handleNonSparkPod(pod *apiv1.Pod, clientset clientset.Interface) error {
 	return updatePod(podCopy, clientset)
 }
 
-func handleConfigMaps(pod *apiv1.Pod, container *apiv1.Container) {
-	sparkConfigMapName, ok := pod.Annotations[config.SparkConfigMapAnnotation]
-	if ok {
-		glog.Infof("Mounting Spark ConfigMap %s to pod %s", sparkConfigMapName, pod.Name)
-		volumeName := config.AddSparkConfigMapVolumeToPod(sparkConfigMapName, pod)
-		config.MountSparkConfigMapToContainer(volumeName, config.DefaultSparkConfDir, container)
-	}
-
-	hadoopConfigMapName, ok := pod.Annotations[config.HadoopConfigMapAnnotation]
-	if ok {
-		glog.Infof("Mounting Hadoop ConfigMap %s to pod %s", hadoopConfigMapName, pod.Name)
-		volumeName := config.AddHadoopConfigMapVolumeToPod(hadoopConfigMapName, pod)
-		config.MountHadoopConfigMapToContainer(volumeName, config.DefaultHadoopConfDir, container)
-	}
-
-	configMaps := config.FindGeneralConfigMaps(pod.Annotations)
-	for name, mountPath := range configMaps {
-		glog.Infof("Mounting ConfigMap %s to pod %s", name, pod.Name)
-		volumeName := name + "-volume"
-		config.AddConfigMapVolumeToPod(volumeName, name, pod)
-		config.MountConfigMapToContainer(volumeName, mountPath, container)
-	}
-}
-
-func handleSecrets(pod *apiv1.Pod, container *apiv1.Container) {
-	secretName, mountPath, found := secret.FindGCPServiceAccountSecret(pod.Annotations)
-	if found {
-		glog.Infof("Mounting GCP service account secret %s to pod %s", secretName, pod.Name)
-		secret.AddSecretVolumeToPod(secret.ServiceAccountSecretVolumeName, secretName, pod)
-		secret.MountServiceAccountSecretToContainer(mountPath, container)
-	}
-
-	secrets := secret.FindGeneralSecrets(pod.Annotations)
-	for name, mountPath := range secrets {
-		glog.Infof("Mounting secret %s to pod %s", name, pod.Name)
-		volumeName := name + "-volume"
-		secret.AddSecretVolumeToPod(volumeName, name, pod)
-		secret.MountSecretToContainer(volumeName, mountPath, container)
-	}
-}
-
-func addOwnerReference(pod *apiv1.Pod) {
-	ownerReferenceStr, ok := pod.Annotations[config.OwnerReferenceAnnotation]
-	if ok {
-		ownerReference := &metav1.OwnerReference{}
-		err := ownerReference.Unmarshal([]byte(ownerReferenceStr))
-		if err != nil {
-			glog.Errorf("failed to add OwnerReference to Pod %s: %v", pod.Name, err)
-		}
-		pod.ObjectMeta.OwnerReferences = append(pod.ObjectMeta.OwnerReferences, *ownerReference)
-	}
-}
-
 // removeSelf removes the initializer from the list of pending initializers of the given Pod.
 func removeSelf(pod *apiv1.Pod) {
 	if pod.Initializers == nil {
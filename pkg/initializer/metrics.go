@@ -0,0 +1,49 @@
+package initializer
+
+import (
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// queueDepth tracks the current number of Pod keys waiting to be processed.
+	queueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "spark_pod_initializer_queue_depth",
+		Help: "Number of Pod keys currently in the initializer work queue.",
+	})
+	// syncLatency tracks how long syncSparkPod spends running the mutation steps on a
+	// Pod, partitioned by driver vs executor. Fetching and patching the Pod are not
+	// included.
+	syncLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "spark_pod_initializer_sync_latency_seconds",
+		Help:    "Time taken by syncSparkPod to run the mutation steps on a Pod.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"role"})
+	// patchErrors counts failures to apply the computed patch to a Pod.
+	patchErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "spark_pod_initializer_patch_errors_total",
+		Help: "Number of errors encountered while patching a Pod.",
+	})
+	// initializerRemovals counts how many times the initializer removed itself from a
+	// Pod, partitioned by driver vs executor and by why the removal happened.
+	initializerRemovals = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spark_pod_initializer_removals_total",
+		Help: "Number of times the initializer was removed from a Pod.",
+	}, []string{"role", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(queueDepth, syncLatency, patchErrors, initializerRemovals)
+}
+
+// ServeMetrics starts an HTTP server exposing the initializer's Prometheus metrics on
+// addr at /metrics. It blocks and only returns once the server stops.
+func ServeMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	glog.Infof("Serving Prometheus metrics on %s", addr)
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,77 @@
+// Package mutation holds the annotation-driven Pod mutation steps shared by the
+// Initializer (pkg/initializer) and admission webhook (pkg/webhook) controller-mode
+// implementations, so the two paths cannot drift apart on which annotations they honor.
+package mutation
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+
+	"github.com/liyinan926/spark-operator/pkg/config"
+	"github.com/liyinan926/spark-operator/pkg/secret"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HandleConfigMaps mounts the Spark/Hadoop conf ConfigMaps and any general ConfigMaps
+// requested through pod annotations into container.
+func HandleConfigMaps(pod *apiv1.Pod, container *apiv1.Container) {
+	sparkConfigMapName, ok := pod.Annotations[config.SparkConfigMapAnnotation]
+	if ok {
+		glog.Infof("Mounting Spark ConfigMap %s to pod %s", sparkConfigMapName, pod.Name)
+		volumeName := config.AddSparkConfigMapVolumeToPod(sparkConfigMapName, pod)
+		config.MountSparkConfigMapToContainer(volumeName, config.DefaultSparkConfDir, container)
+	}
+
+	hadoopConfigMapName, ok := pod.Annotations[config.HadoopConfigMapAnnotation]
+	if ok {
+		glog.Infof("Mounting Hadoop ConfigMap %s to pod %s", hadoopConfigMapName, pod.Name)
+		volumeName := config.AddHadoopConfigMapVolumeToPod(hadoopConfigMapName, pod)
+		config.MountHadoopConfigMapToContainer(volumeName, config.DefaultHadoopConfDir, container)
+	}
+
+	configMaps := config.FindGeneralConfigMaps(pod.Annotations)
+	for name, mountPath := range configMaps {
+		glog.Infof("Mounting ConfigMap %s to pod %s", name, pod.Name)
+		volumeName := name + "-volume"
+		config.AddConfigMapVolumeToPod(volumeName, name, pod)
+		config.MountConfigMapToContainer(volumeName, mountPath, container)
+	}
+}
+
+// HandleSecrets mounts the GCP service account secret and any general secrets requested
+// through pod annotations into container.
+func HandleSecrets(pod *apiv1.Pod, container *apiv1.Container) {
+	secretName, mountPath, found := secret.FindGCPServiceAccountSecret(pod.Annotations)
+	if found {
+		glog.Infof("Mounting GCP service account secret %s to pod %s", secretName, pod.Name)
+		secret.AddSecretVolumeToPod(secret.ServiceAccountSecretVolumeName, secretName, pod)
+		secret.MountServiceAccountSecretToContainer(mountPath, container)
+	}
+
+	secrets := secret.FindGeneralSecrets(pod.Annotations)
+	for name, mountPath := range secrets {
+		glog.Infof("Mounting secret %s to pod %s", name, pod.Name)
+		volumeName := name + "-volume"
+		secret.AddSecretVolumeToPod(volumeName, name, pod)
+		secret.MountSecretToContainer(volumeName, mountPath, container)
+	}
+}
+
+// AddOwnerReference adds the OwnerReference encoded in the owner reference annotation on
+// pod, if present.
+func AddOwnerReference(pod *apiv1.Pod) error {
+	ownerReferenceStr, ok := pod.Annotations[config.OwnerReferenceAnnotation]
+	if !ok {
+		return nil
+	}
+
+	ownerReference := &metav1.OwnerReference{}
+	if err := ownerReference.Unmarshal([]byte(ownerReferenceStr)); err != nil {
+		return fmt.Errorf("failed to unmarshal OwnerReference annotation on Pod %s: %v", pod.Name, err)
+	}
+	pod.ObjectMeta.OwnerReferences = append(pod.ObjectMeta.OwnerReferences, *ownerReference)
+	return nil
+}
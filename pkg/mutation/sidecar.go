@@ -0,0 +1,191 @@
+package mutation
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// sidecarAnnotationPrefix is the prefix of annotations whose values are JSON-encoded
+	// v1.Container specs to be appended to the Pod's containers as sidecars, e.g. a
+	// Prometheus JMX exporter or a log shipper running alongside the Spark container.
+	// A value may also be a "configMapKeyRef:<configMapName>:<key>" reference to a key in
+	// a ConfigMap in the Pod's namespace holding the JSON-encoded spec instead.
+	sidecarAnnotationPrefix = "sidecar.sparkoperator.k8s.io/"
+	// initContainerAnnotationPrefix is the prefix of annotations whose values are
+	// JSON-encoded v1.Container specs, or configMapKeyRef references to one, to be
+	// appended to the Pod's init containers, e.g. one that stages dependency jars before
+	// the Spark container starts.
+	initContainerAnnotationPrefix = "initcontainer.sparkoperator.k8s.io/"
+	// sharedVolumeAnnotationPrefix is the prefix of annotations whose values are
+	// JSON-encoded v1.Volume specs of emptyDir volumes shared between the Spark
+	// container and the containers injected through the two annotations above.
+	sharedVolumeAnnotationPrefix = "sharedvolume.sparkoperator.k8s.io/"
+	// sharedVolumeMountPathAnnotationPrefix gives the mount path a shared volume should
+	// be mounted at in the Spark container itself; sidecars and init containers mount it
+	// at the path given in their own container spec.
+	sharedVolumeMountPathAnnotationPrefix = "sharedvolumemountpath.sparkoperator.k8s.io/"
+	// configMapKeyRefPrefix marks a sidecar/init container annotation value as a
+	// reference to a key in a ConfigMap holding the JSON-encoded container spec, rather
+	// than carrying the spec inline.
+	configMapKeyRefPrefix = "configMapKeyRef:"
+)
+
+// HandleSidecars appends any sidecar and init containers requested through pod
+// annotations to the Pod's container lists, in a deterministic order based on the
+// annotation name, and wires up any shared emptyDir volumes declared alongside them so
+// the Spark container and its sidecars can exchange files.
+func HandleSidecars(pod *apiv1.Pod, appContainer *apiv1.Container, kubeClient clientset.Interface) error {
+	if err := addSharedVolumes(pod, appContainer); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, container := range pod.Spec.Containers {
+		seen[container.Name] = true
+	}
+	for _, container := range pod.Spec.InitContainers {
+		seen[container.Name] = true
+	}
+
+	sidecars, err := parseContainerAnnotations(pod, sidecarAnnotationPrefix, kubeClient)
+	if err != nil {
+		return fmt.Errorf("failed to parse sidecar annotations on Pod %s: %v", pod.Name, err)
+	}
+	for _, named := range sidecars {
+		if seen[named.container.Name] {
+			return fmt.Errorf("container %s is already present in Pod %s", named.container.Name, pod.Name)
+		}
+		seen[named.container.Name] = true
+		glog.Infof("Adding sidecar container %s to Pod %s", named.name, pod.Name)
+		pod.Spec.Containers = append(pod.Spec.Containers, named.container)
+	}
+
+	initContainers, err := parseContainerAnnotations(pod, initContainerAnnotationPrefix, kubeClient)
+	if err != nil {
+		return fmt.Errorf("failed to parse init container annotations on Pod %s: %v", pod.Name, err)
+	}
+	for _, named := range initContainers {
+		if seen[named.container.Name] {
+			return fmt.Errorf("container %s is already present in Pod %s", named.container.Name, pod.Name)
+		}
+		seen[named.container.Name] = true
+		glog.Infof("Adding init container %s to Pod %s", named.name, pod.Name)
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, named.container)
+	}
+
+	return nil
+}
+
+// namedContainer pairs a container spec parsed out of an annotation with the name
+// suffix of that annotation, so callers can append containers in a stable order.
+type namedContainer struct {
+	name      string
+	container apiv1.Container
+}
+
+// parseContainerAnnotations returns the v1.Container specs encoded in the annotations
+// carrying the given prefix, sorted by the annotation's name suffix so that init
+// containers -- which run sequentially and may depend on each other -- are appended in a
+// deterministic order instead of Go's randomized map iteration order. An annotation
+// value may either be inline JSON or a "configMapKeyRef:<configMapName>:<key>"
+// reference to a key in a ConfigMap in the Pod's namespace holding the JSON.
+func parseContainerAnnotations(pod *apiv1.Pod, prefix string, kubeClient clientset.Interface) ([]namedContainer, error) {
+	var names []string
+	for key := range pod.Annotations {
+		if strings.HasPrefix(key, prefix) {
+			names = append(names, strings.TrimPrefix(key, prefix))
+		}
+	}
+	sort.Strings(names)
+
+	containers := make([]namedContainer, 0, len(names))
+	for _, name := range names {
+		spec, err := resolveContainerSpec(pod, prefix+name, kubeClient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve container spec %s: %v", name, err)
+		}
+		var container apiv1.Container
+		if err := json.Unmarshal(spec, &container); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal container spec %s: %v", name, err)
+		}
+		containers = append(containers, namedContainer{name: name, container: container})
+	}
+	return containers, nil
+}
+
+// resolveContainerSpec returns the raw JSON container spec carried by the annotation
+// key, dereferencing a configMapKeyRef value against the Pod's namespace if present.
+func resolveContainerSpec(pod *apiv1.Pod, key string, kubeClient clientset.Interface) ([]byte, error) {
+	value := pod.Annotations[key]
+	if !strings.HasPrefix(value, configMapKeyRefPrefix) {
+		return []byte(value), nil
+	}
+
+	ref := strings.TrimPrefix(value, configMapKeyRefPrefix)
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed configMapKeyRef %q, expected configMapKeyRef:<name>:<key>", value)
+	}
+	configMapName, dataKey := parts[0], parts[1]
+
+	configMap, err := kubeClient.CoreV1().ConfigMaps(pod.Namespace).Get(configMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ConfigMap %s: %v", configMapName, err)
+	}
+	spec, ok := configMap.Data[dataKey]
+	if !ok {
+		return nil, fmt.Errorf("ConfigMap %s has no key %s", configMapName, dataKey)
+	}
+	return []byte(spec), nil
+}
+
+// addSharedVolumes adds the emptyDir volumes declared through sharedvolume annotations
+// to the Pod spec and mounts each onto the Spark container at the path given by the
+// matching sharedvolumemountpath annotation. It rejects a shared volume whose name
+// collides with a volume already present in the Pod, e.g. one added by HandleVolumes from
+// a volume.sparkoperator.k8s.io annotation of the same name.
+func addSharedVolumes(pod *apiv1.Pod, appContainer *apiv1.Container) error {
+	seen := make(map[string]bool)
+	for _, volume := range pod.Spec.Volumes {
+		seen[volume.Name] = true
+	}
+
+	for key, value := range pod.Annotations {
+		if !strings.HasPrefix(key, sharedVolumeAnnotationPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, sharedVolumeAnnotationPrefix)
+
+		if seen[name] {
+			return fmt.Errorf("volume %s is already present in Pod %s", name, pod.Name)
+		}
+
+		var volume apiv1.Volume
+		if err := json.Unmarshal([]byte(value), &volume); err != nil {
+			return fmt.Errorf("failed to unmarshal shared volume spec %s: %v", name, err)
+		}
+		volume.Name = name
+		pod.Spec.Volumes = append(pod.Spec.Volumes, volume)
+		seen[name] = true
+
+		mountPath, ok := pod.Annotations[sharedVolumeMountPathAnnotationPrefix+name]
+		if !ok {
+			continue
+		}
+		glog.Infof("Mounting shared volume %s to the Spark container in Pod %s", name, pod.Name)
+		appContainer.VolumeMounts = append(appContainer.VolumeMounts, apiv1.VolumeMount{
+			Name:      name,
+			MountPath: mountPath,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package mutation
+
+import (
+	"encoding/json"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func sidecarAnnotation(t *testing.T, name string) string {
+	t.Helper()
+	b, err := json.Marshal(apiv1.Container{Name: name})
+	if err != nil {
+		t.Fatalf("failed to marshal container spec: %v", err)
+	}
+	return string(b)
+}
+
+func TestHandleSidecarsDeterministicOrder(t *testing.T) {
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "driver",
+			Annotations: map[string]string{
+				sidecarAnnotationPrefix + "b": sidecarAnnotation(t, "b-sidecar"),
+				sidecarAnnotationPrefix + "a": sidecarAnnotation(t, "a-sidecar"),
+			},
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: "spark-driver"}},
+		},
+	}
+	appContainer := &pod.Spec.Containers[0]
+
+	if err := HandleSidecars(pod, appContainer, fake.NewSimpleClientset()); err != nil {
+		t.Fatalf("HandleSidecars returned an error: %v", err)
+	}
+
+	want := []string{"spark-driver", "a-sidecar", "b-sidecar"}
+	if len(pod.Spec.Containers) != len(want) {
+		t.Fatalf("got %d containers, want %d", len(pod.Spec.Containers), len(want))
+	}
+	for i, name := range want {
+		if pod.Spec.Containers[i].Name != name {
+			t.Errorf("container %d: got name %s, want %s", i, pod.Spec.Containers[i].Name, name)
+		}
+	}
+}
+
+func TestHandleSidecarsRejectsNameCollisionWithAppContainer(t *testing.T) {
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "driver",
+			Annotations: map[string]string{
+				sidecarAnnotationPrefix + "a": sidecarAnnotation(t, "spark-driver"),
+			},
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: "spark-driver"}},
+		},
+	}
+	appContainer := &pod.Spec.Containers[0]
+
+	if err := HandleSidecars(pod, appContainer, fake.NewSimpleClientset()); err == nil {
+		t.Fatal("expected an error for a sidecar reusing the Spark container's name, got none")
+	}
+}
+
+func TestHandleSidecarsRejectsSidecarAndInitContainerNameCollision(t *testing.T) {
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "driver",
+			Annotations: map[string]string{
+				sidecarAnnotationPrefix + "a":       sidecarAnnotation(t, "dup"),
+				initContainerAnnotationPrefix + "b": sidecarAnnotation(t, "dup"),
+			},
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: "spark-driver"}},
+		},
+	}
+	appContainer := &pod.Spec.Containers[0]
+
+	if err := HandleSidecars(pod, appContainer, fake.NewSimpleClientset()); err == nil {
+		t.Fatal("expected an error for a sidecar and init container sharing the same name, got none")
+	}
+}
@@ -0,0 +1,104 @@
+package mutation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"github.com/liyinan926/spark-operator/pkg/config"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const (
+	// volumeAnnotationPrefix is the prefix of annotations whose values are JSON-encoded
+	// v1.Volume specs to add to the Pod, e.g. an existing PVC for shuffle spill, an
+	// emptyDir with medium: Memory for /tmp acceleration, a projected volume combining a
+	// serviceaccount token with a downwardAPI, or a hostPath for GPU device libraries.
+	volumeAnnotationPrefix = "volume.sparkoperator.k8s.io/"
+	// volumeMountAnnotationPrefix gives the mount path for the volume declared under the
+	// matching volumeAnnotationPrefix annotation. The value may optionally carry a
+	// subPath and/or readOnly flag after the mount path, separated by colons, e.g.
+	// "/data:some/sub/path:ro".
+	volumeMountAnnotationPrefix = "volumemount.sparkoperator.k8s.io/"
+)
+
+// HandleVolumes adds the volumes requested through volume.sparkoperator.k8s.io
+// annotations to the Pod and mounts each onto the Spark container at the path given by
+// the matching volumemount.sparkoperator.k8s.io annotation.
+func HandleVolumes(pod *apiv1.Pod, container *apiv1.Container) error {
+	seen := make(map[string]bool)
+	for _, volume := range pod.Spec.Volumes {
+		seen[volume.Name] = true
+	}
+
+	for key, value := range pod.Annotations {
+		if !strings.HasPrefix(key, volumeAnnotationPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, volumeAnnotationPrefix)
+
+		if seen[name] {
+			return fmt.Errorf("volume %s is already present in Pod %s", name, pod.Name)
+		}
+
+		var volume apiv1.Volume
+		if err := json.Unmarshal([]byte(value), &volume); err != nil {
+			return fmt.Errorf("failed to unmarshal volume spec %s: %v", name, err)
+		}
+		volume.Name = name
+
+		mountPathSpec, ok := pod.Annotations[volumeMountAnnotationPrefix+name]
+		if !ok {
+			return fmt.Errorf("missing %s annotation for volume %s", volumeMountAnnotationPrefix+name, name)
+		}
+		mount, err := parseVolumeMount(name, mountPathSpec)
+		if err != nil {
+			return err
+		}
+		if err := checkMountPathCollision(mount.MountPath); err != nil {
+			return err
+		}
+
+		glog.Infof("Mounting volume %s to pod %s at %s", name, pod.Name, mount.MountPath)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, volume)
+		container.VolumeMounts = append(container.VolumeMounts, *mount)
+		seen[name] = true
+	}
+
+	return nil
+}
+
+// parseVolumeMount parses a volumemount annotation value of the form
+// "<mountPath>[:<subPath>][:ro]" into a v1.VolumeMount named name.
+func parseVolumeMount(name, spec string) (*apiv1.VolumeMount, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) == 0 || parts[0] == "" {
+		return nil, fmt.Errorf("empty mount path for volume %s", name)
+	}
+
+	mount := &apiv1.VolumeMount{
+		Name:      name,
+		MountPath: parts[0],
+	}
+	for _, part := range parts[1:] {
+		if part == "ro" {
+			mount.ReadOnly = true
+		} else {
+			mount.SubPath = part
+		}
+	}
+
+	return mount, nil
+}
+
+// checkMountPathCollision rejects a mount path that collides with the fixed Spark or
+// Hadoop conf directories ConfigMaps are mounted into.
+func checkMountPathCollision(mountPath string) error {
+	if mountPath == config.DefaultSparkConfDir || mountPath == config.DefaultHadoopConfDir {
+		return fmt.Errorf("mount path %s collides with a reserved Spark/Hadoop conf mount", mountPath)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package mutation
+
+import (
+	"testing"
+
+	"github.com/liyinan926/spark-operator/pkg/config"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestParseVolumeMount(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    *apiv1.VolumeMount
+		wantErr bool
+	}{
+		{
+			name: "mount path only",
+			spec: "/data",
+			want: &apiv1.VolumeMount{Name: "vol", MountPath: "/data"},
+		},
+		{
+			name: "mount path with subPath",
+			spec: "/data:some/sub/path",
+			want: &apiv1.VolumeMount{Name: "vol", MountPath: "/data", SubPath: "some/sub/path"},
+		},
+		{
+			name: "mount path with readOnly flag",
+			spec: "/data:ro",
+			want: &apiv1.VolumeMount{Name: "vol", MountPath: "/data", ReadOnly: true},
+		},
+		{
+			name: "mount path with subPath and readOnly flag",
+			spec: "/data:some/sub/path:ro",
+			want: &apiv1.VolumeMount{Name: "vol", MountPath: "/data", SubPath: "some/sub/path", ReadOnly: true},
+		},
+		{
+			name:    "empty spec",
+			spec:    "",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseVolumeMount("vol", test.spec)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error for spec %q, got none", test.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for spec %q: %v", test.spec, err)
+			}
+			if *got != *test.want {
+				t.Errorf("parseVolumeMount(%q) = %+v, want %+v", test.spec, *got, *test.want)
+			}
+		})
+	}
+}
+
+func TestCheckMountPathCollision(t *testing.T) {
+	tests := []struct {
+		name      string
+		mountPath string
+		wantErr   bool
+	}{
+		{name: "spark conf dir collides", mountPath: config.DefaultSparkConfDir, wantErr: true},
+		{name: "hadoop conf dir collides", mountPath: config.DefaultHadoopConfDir, wantErr: true},
+		{name: "unrelated path does not collide", mountPath: "/data"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkMountPathCollision(test.mountPath)
+			if test.wantErr && err == nil {
+				t.Fatalf("expected an error for mount path %q, got none", test.mountPath)
+			}
+			if !test.wantErr && err != nil {
+				t.Fatalf("unexpected error for mount path %q: %v", test.mountPath, err)
+			}
+		})
+	}
+}
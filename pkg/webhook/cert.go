@@ -0,0 +1,226 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// certSecretName is the name of the Secret the webhook's self-signed serving
+	// certificate and private key are persisted to and rotated in.
+	certSecretName = "spark-webhook-certs"
+	// certValidity is how long a generated serving certificate is valid for.
+	certValidity = 365 * 24 * time.Hour
+	// certRenewalThreshold is how long before a certificate's expiry loadOrGenerate
+	// treats it as due for rotation, so the webhook server picks up a fresh certificate
+	// well ahead of the old one actually expiring.
+	certRenewalThreshold = 30 * 24 * time.Hour
+	// certRecheckInterval is how often the background rotation loop re-checks whether
+	// the serving certificate needs to be rotated.
+	certRecheckInterval = 1 * time.Hour
+)
+
+// certProvider generates and rotates a self-signed serving certificate for the webhook
+// server and makes the CA bundle available for the MutatingWebhookConfiguration.
+type certProvider struct {
+	kubeClient       clientset.Interface
+	serviceNamespace string
+	serviceName      string
+
+	mutex  sync.RWMutex
+	cert   *tls.Certificate
+	caCert []byte
+}
+
+func newCertProvider(kubeClient clientset.Interface, serviceNamespace, serviceName string) (*certProvider, error) {
+	cp := &certProvider{
+		kubeClient:       kubeClient,
+		serviceNamespace: serviceNamespace,
+		serviceName:      serviceName,
+	}
+
+	if err := cp.loadOrGenerate(); err != nil {
+		return nil, err
+	}
+
+	return cp, nil
+}
+
+func (cp *certProvider) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cp.mutex.RLock()
+	defer cp.mutex.RUnlock()
+	return cp.cert, nil
+}
+
+// loadOrGenerate fetches the certificate Secret if one already exists and is still valid,
+// or otherwise generates a new self-signed certificate/key pair and persists it.
+func (cp *certProvider) loadOrGenerate() error {
+	secretsClient := cp.kubeClient.CoreV1().Secrets(cp.serviceNamespace)
+	existing, err := secretsClient.Get(certSecretName, metav1.GetOptions{})
+	notFound := errors.IsNotFound(err)
+	if err == nil {
+		cert, caCert, parseErr := parseCertSecret(existing)
+		if parseErr == nil && time.Now().Before(cert.Leaf.NotAfter.Add(-certRenewalThreshold)) {
+			cp.setCertificate(cert, caCert)
+			return nil
+		}
+		glog.Infof("Existing serving certificate in Secret %s is invalid or expiring, regenerating", certSecretName)
+	} else if !notFound {
+		return fmt.Errorf("failed to get Secret %s: %v", certSecretName, err)
+	}
+
+	certPEM, keyPEM, caPEM, err := generateSelfSignedCert(fmt.Sprintf("%s.%s.svc", cp.serviceName, cp.serviceNamespace))
+	if err != nil {
+		return fmt.Errorf("failed to generate a self-signed certificate: %v", err)
+	}
+
+	newSecret := &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      certSecretName,
+			Namespace: cp.serviceNamespace,
+		},
+		Data: map[string][]byte{
+			apiv1.TLSCertKey:       certPEM,
+			apiv1.TLSPrivateKeyKey: keyPEM,
+			"ca.crt":               caPEM,
+		},
+		Type: apiv1.SecretTypeTLS,
+	}
+
+	if notFound {
+		_, err = secretsClient.Create(newSecret)
+	} else {
+		newSecret.ResourceVersion = existing.ResourceVersion
+		_, err = secretsClient.Update(newSecret)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to persist the serving certificate Secret %s: %v", certSecretName, err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to load the generated certificate/key pair: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse the generated certificate: %v", err)
+	}
+	cert.Leaf = leaf
+
+	cp.setCertificate(&cert, caPEM)
+	return nil
+}
+
+// runRotation periodically re-checks the serving certificate and rotates it once it gets
+// within certRenewalThreshold of expiring, so a long-lived webhook pod keeps serving a
+// valid certificate without needing a restart. It returns when stopCh is closed.
+func (cp *certProvider) runRotation(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(certRecheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := cp.loadOrGenerate(); err != nil {
+				glog.Errorf("Failed to rotate the serving certificate: %v", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (cp *certProvider) setCertificate(cert *tls.Certificate, caCert []byte) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	cp.cert = cert
+	cp.caCert = caCert
+}
+
+func parseCertSecret(secret *apiv1.Secret) (*tls.Certificate, []byte, error) {
+	certPEM, ok := secret.Data[apiv1.TLSCertKey]
+	if !ok {
+		return nil, nil, fmt.Errorf("Secret %s is missing %s", secret.Name, apiv1.TLSCertKey)
+	}
+	keyPEM, ok := secret.Data[apiv1.TLSPrivateKeyKey]
+	if !ok {
+		return nil, nil, fmt.Errorf("Secret %s is missing %s", secret.Name, apiv1.TLSPrivateKeyKey)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	cert.Leaf = leaf
+
+	return &cert, secret.Data["ca.crt"], nil
+}
+
+// generateSelfSignedCert creates a self-signed CA and a leaf serving certificate for the
+// given DNS name, returning the PEM-encoded leaf cert, its private key, and the CA cert.
+func generateSelfSignedCert(dnsName string) ([]byte, []byte, []byte, error) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "spark-webhook-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(certValidity),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caCert, &leafKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(leafKey)})
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+
+	return certPEM, keyPEM, caPEM, nil
+}
@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGenerateSelfSignedCert(t *testing.T) {
+	certPEM, keyPEM, caPEM, err := generateSelfSignedCert("spark-webhook.default.svc")
+	if err != nil {
+		t.Fatalf("generateSelfSignedCert returned an error: %v", err)
+	}
+	if len(certPEM) == 0 || len(keyPEM) == 0 || len(caPEM) == 0 {
+		t.Fatalf("expected non-empty cert, key and CA PEM blocks, got %d/%d/%d bytes", len(certPEM), len(keyPEM), len(caPEM))
+	}
+
+	secret := &apiv1.Secret{
+		Data: map[string][]byte{
+			apiv1.TLSCertKey:       certPEM,
+			apiv1.TLSPrivateKeyKey: keyPEM,
+			"ca.crt":               caPEM,
+		},
+	}
+	cert, caCert, err := parseCertSecret(secret)
+	if err != nil {
+		t.Fatalf("parseCertSecret returned an error: %v", err)
+	}
+	if cert.Leaf.Subject.CommonName != "spark-webhook.default.svc" {
+		t.Errorf("got CommonName %q, want %q", cert.Leaf.Subject.CommonName, "spark-webhook.default.svc")
+	}
+	if string(caCert) != string(caPEM) {
+		t.Errorf("parseCertSecret returned a CA cert that does not match the one in the Secret")
+	}
+
+	wantNotAfter := time.Now().Add(certValidity)
+	if cert.Leaf.NotAfter.Before(wantNotAfter.Add(-time.Minute)) || cert.Leaf.NotAfter.After(wantNotAfter.Add(time.Minute)) {
+		t.Errorf("got NotAfter %v, want close to %v", cert.Leaf.NotAfter, wantNotAfter)
+	}
+}
+
+func TestParseCertSecretMissingKeys(t *testing.T) {
+	if _, _, err := parseCertSecret(&apiv1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "spark-webhook-certs"}}); err == nil {
+		t.Fatal("expected an error for a Secret missing the cert/key data, got none")
+	}
+}
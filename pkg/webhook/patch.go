@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/glog"
+
+	"github.com/liyinan926/spark-operator/pkg/mutation"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// patchOperation represents a single operation of a JSONPatch, as defined in RFC 6902.
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// mutatePod applies the same annotation-driven mutations that syncSparkPod applies in
+// pkg/initializer -- ConfigMaps, Secrets, owner references, general volumes, and
+// sidecar/init containers -- and returns an AdmissionResponse carrying the resulting
+// JSONPatch.
+func mutatePod(pod *apiv1.Pod, kubeClient clientset.Interface, uid types.UID) *admissionv1beta1.AdmissionResponse {
+	if pod.Labels[sparkRoleLabel] == "" {
+		return &admissionv1beta1.AdmissionResponse{UID: uid, Allowed: true}
+	}
+
+	glog.Infof("Mutating Spark %s pod %s", pod.Labels[sparkRoleLabel], pod.Name)
+
+	copyObj, err := runtime.NewScheme().DeepCopy(pod)
+	if err != nil {
+		return admissionResponseWithError(err, uid)
+	}
+	modifiedPod := copyObj.(*apiv1.Pod)
+	if len(modifiedPod.Spec.Containers) <= 0 {
+		return &admissionv1beta1.AdmissionResponse{UID: uid, Allowed: true}
+	}
+	appContainer := &modifiedPod.Spec.Containers[0]
+
+	if err := mutation.AddOwnerReference(modifiedPod); err != nil {
+		return admissionResponseWithError(err, uid)
+	}
+	mutation.HandleConfigMaps(modifiedPod, appContainer)
+	mutation.HandleSecrets(modifiedPod, appContainer)
+	if err := mutation.HandleVolumes(modifiedPod, appContainer); err != nil {
+		return admissionResponseWithError(err, uid)
+	}
+	if err := mutation.HandleSidecars(modifiedPod, appContainer, kubeClient); err != nil {
+		return admissionResponseWithError(err, uid)
+	}
+
+	patchBytes, err := buildPatch(pod, modifiedPod)
+	if err != nil {
+		return admissionResponseWithError(err, uid)
+	}
+
+	patchType := admissionv1beta1.PatchTypeJSONPatch
+	return &admissionv1beta1.AdmissionResponse{
+		UID:       uid,
+		Allowed:   true,
+		Patch:     patchBytes,
+		PatchType: &patchType,
+	}
+}
+
+// buildPatch diffs the original and modified pods and produces a JSONPatch covering the
+// owner reference, volumes, volume mounts, and appended sidecar/init containers,
+// mirroring the fields syncSparkPod mutates.
+func buildPatch(pod, modifiedPod *apiv1.Pod) ([]byte, error) {
+	var patch []patchOperation
+
+	if len(modifiedPod.ObjectMeta.OwnerReferences) > len(pod.ObjectMeta.OwnerReferences) {
+		op := "replace"
+		if len(pod.ObjectMeta.OwnerReferences) == 0 {
+			op = "add"
+		}
+		patch = append(patch, patchOperation{
+			Op:    op,
+			Path:  "/metadata/ownerReferences",
+			Value: modifiedPod.ObjectMeta.OwnerReferences,
+		})
+	}
+
+	if len(modifiedPod.Spec.Volumes) > 0 {
+		path := "/spec/volumes"
+		if len(pod.Spec.Volumes) == 0 {
+			patch = append(patch, patchOperation{Op: "add", Path: path, Value: modifiedPod.Spec.Volumes})
+		} else {
+			patch = append(patch, patchOperation{Op: "replace", Path: path, Value: modifiedPod.Spec.Volumes})
+		}
+	}
+
+	// Only the containers present in the original Pod can have gained volume mounts;
+	// containers appended by mutation.HandleSidecars are covered by the "add" below instead.
+	for i, container := range pod.Spec.Containers {
+		if len(modifiedPod.Spec.Containers[i].VolumeMounts) > len(container.VolumeMounts) {
+			op := "replace"
+			if len(container.VolumeMounts) == 0 {
+				op = "add"
+			}
+			patch = append(patch, patchOperation{
+				Op:    op,
+				Path:  fmt.Sprintf("/spec/containers/%d/volumeMounts", i),
+				Value: modifiedPod.Spec.Containers[i].VolumeMounts,
+			})
+		}
+	}
+
+	for _, sidecar := range modifiedPod.Spec.Containers[len(pod.Spec.Containers):] {
+		patch = append(patch, patchOperation{Op: "add", Path: "/spec/containers/-", Value: sidecar})
+	}
+
+	if len(modifiedPod.Spec.InitContainers) > 0 {
+		path := "/spec/initContainers"
+		if len(pod.Spec.InitContainers) == 0 {
+			patch = append(patch, patchOperation{Op: "add", Path: path, Value: modifiedPod.Spec.InitContainers})
+		} else {
+			patch = append(patch, patchOperation{Op: "replace", Path: path, Value: modifiedPod.Spec.InitContainers})
+		}
+	}
+
+	return json.Marshal(patch)
+}
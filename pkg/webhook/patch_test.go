@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"encoding/json"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBuildPatch(t *testing.T) {
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "driver"},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: "spark-driver"}},
+		},
+	}
+
+	modifiedPod := pod.DeepCopy()
+	modifiedPod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{{Name: "owner"}}
+	modifiedPod.Spec.Volumes = []apiv1.Volume{{Name: "vol"}}
+	modifiedPod.Spec.Containers[0].VolumeMounts = []apiv1.VolumeMount{{Name: "vol", MountPath: "/data"}}
+	modifiedPod.Spec.Containers = append(modifiedPod.Spec.Containers, apiv1.Container{Name: "sidecar"})
+	modifiedPod.Spec.InitContainers = []apiv1.Container{{Name: "init"}}
+
+	patchBytes, err := buildPatch(pod, modifiedPod)
+	if err != nil {
+		t.Fatalf("buildPatch returned an error: %v", err)
+	}
+
+	var patch []patchOperation
+	if err := json.Unmarshal(patchBytes, &patch); err != nil {
+		t.Fatalf("failed to unmarshal patch: %v", err)
+	}
+
+	wantOps := map[string]string{
+		"/metadata/ownerReferences":       "add",
+		"/spec/volumes":                   "add",
+		"/spec/containers/0/volumeMounts": "add",
+		"/spec/containers/-":              "add",
+		"/spec/initContainers":            "add",
+	}
+	if len(patch) != len(wantOps) {
+		t.Fatalf("got %d patch operations, want %d: %+v", len(patch), len(wantOps), patch)
+	}
+	for _, op := range patch {
+		wantOp, ok := wantOps[op.Path]
+		if !ok {
+			t.Errorf("unexpected patch path %s", op.Path)
+			continue
+		}
+		if op.Op != wantOp {
+			t.Errorf("path %s: got op %s, want %s", op.Path, op.Op, wantOp)
+		}
+	}
+}
+
+func TestBuildPatchNoChanges(t *testing.T) {
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "driver"},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{{Name: "spark-driver"}},
+		},
+	}
+	modifiedPod := pod.DeepCopy()
+
+	patchBytes, err := buildPatch(pod, modifiedPod)
+	if err != nil {
+		t.Fatalf("buildPatch returned an error: %v", err)
+	}
+
+	var patch []patchOperation
+	if err := json.Unmarshal(patchBytes, &patch); err != nil {
+		t.Fatalf("failed to unmarshal patch: %v", err)
+	}
+	if len(patch) != 0 {
+		t.Errorf("expected no patch operations for an unmodified pod, got %+v", patch)
+	}
+}
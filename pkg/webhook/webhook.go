@@ -0,0 +1,206 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/golang/glog"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	arv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// webhookName is the name of the MutatingWebhookConfiguration entry registered for this webhook.
+	webhookName = "webhook.sparkoperator.k8s.io"
+	// webhookConfigName is the name of the MutatingWebhookConfiguration object.
+	webhookConfigName = "spark-pod-webhook-config"
+	// sparkRoleLabel is the label we use to distinguish Spark pods from other pods.
+	sparkRoleLabel = "spark-role"
+	// mutatePath is the HTTPS path the webhook server serves AdmissionReview requests on.
+	mutatePath = "/mutate"
+)
+
+// WebhookController runs an HTTPS admission webhook server that mutates Spark driver and
+// executor pods based on annotations. It is the successor to the deprecated
+// Initializer-based pkg/initializer.SparkPodInitializer.
+type WebhookController struct {
+	kubeClient   clientset.Interface
+	certProvider *certProvider
+	server       *http.Server
+}
+
+// New creates a new WebhookController instance.
+func New(kubeClient clientset.Interface, serviceNamespace, serviceName string, port int) (*WebhookController, error) {
+	certProvider, err := newCertProvider(kubeClient, serviceNamespace, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up the serving certificate: %v", err)
+	}
+
+	wc := &WebhookController{
+		kubeClient:   kubeClient,
+		certProvider: certProvider,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(mutatePath, wc.serveMutatePods)
+	wc.server = &http.Server{
+		Addr:      fmt.Sprintf(":%d", port),
+		Handler:   mux,
+		TLSConfig: &tls.Config{GetCertificate: certProvider.getCertificate},
+	}
+
+	return wc, nil
+}
+
+// Start registers the MutatingWebhookConfiguration and starts serving admission requests.
+// It blocks until the HTTPS server returns an error or is shut down.
+func (wc *WebhookController) Start(stopCh <-chan struct{}) error {
+	glog.Infof("Registering the MutatingWebhookConfiguration %s", webhookConfigName)
+	if err := wc.syncWebhookConfiguration(); err != nil {
+		return fmt.Errorf("failed to register MutatingWebhookConfiguration %s: %v", webhookConfigName, err)
+	}
+
+	go wc.certProvider.runRotation(stopCh)
+
+	errCh := make(chan error, 1)
+	go func() {
+		glog.Infof("Starting the Spark Pod admission webhook server on %s", wc.server.Addr)
+		errCh <- wc.server.ListenAndServeTLS("", "")
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-stopCh:
+		glog.Info("Stopping the Spark Pod admission webhook server")
+		if err := wc.server.Shutdown(context.Background()); err != nil {
+			return fmt.Errorf("failed to shut down the admission webhook server cleanly: %v", err)
+		}
+		glog.Infof("Deleting the MutatingWebhookConfiguration %s", webhookConfigName)
+		return wc.deleteWebhookConfiguration()
+	}
+}
+
+func (wc *WebhookController) syncWebhookConfiguration() error {
+	path := mutatePath
+	failurePolicy := arv1beta1.Ignore
+	webhook := arv1beta1.Webhook{
+		Name: webhookName,
+		Rules: []arv1beta1.RuleWithOperations{
+			{
+				Operations: []arv1beta1.OperationType{arv1beta1.Create},
+				Rule: arv1beta1.Rule{
+					APIGroups:   []string{""},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"pods"},
+				},
+			},
+		},
+		ClientConfig: arv1beta1.WebhookClientConfig{
+			Service: &arv1beta1.ServiceReference{
+				Namespace: wc.certProvider.serviceNamespace,
+				Name:      wc.certProvider.serviceName,
+				Path:      &path,
+			},
+			CABundle: wc.certProvider.caCert,
+		},
+		Selector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{
+					Key:      sparkRoleLabel,
+					Operator: metav1.LabelSelectorOpExists,
+				},
+			},
+		},
+		FailurePolicy: &failurePolicy,
+	}
+	webhookConfig := &arv1beta1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: webhookConfigName,
+		},
+		Webhooks: []arv1beta1.Webhook{webhook},
+	}
+
+	client := wc.kubeClient.AdmissionregistrationV1beta1().MutatingWebhookConfigurations()
+	existing, err := client.Get(webhookConfigName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			_, err = client.Create(webhookConfig)
+			if err != nil {
+				return fmt.Errorf("failed to create MutatingWebhookConfiguration: %v", err)
+			}
+			return nil
+		}
+		return fmt.Errorf("failed to get MutatingWebhookConfiguration: %v", err)
+	}
+
+	existing.Webhooks = []arv1beta1.Webhook{webhook}
+	if _, err := client.Update(existing); err != nil {
+		return fmt.Errorf("failed to update MutatingWebhookConfiguration: %v", err)
+	}
+	return nil
+}
+
+func (wc *WebhookController) deleteWebhookConfiguration() error {
+	err := wc.kubeClient.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Delete(webhookConfigName, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete MutatingWebhookConfiguration: %v", err)
+	}
+	return nil
+}
+
+// serveMutatePods handles an admission.k8s.io/v1beta1 AdmissionReview request for a Pod
+// and responds with a JSONPatch that applies the same annotation-driven mutations
+// syncSparkPod performs. AdmissionReview requests of the admission.k8s.io/v1 API are not
+// decoded. See mutatePod for the mutations this covers.
+func (wc *WebhookController) serveMutatePods(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review := &admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil {
+		http.Error(w, fmt.Sprintf("failed to unmarshal AdmissionReview: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var pod apiv1.Pod
+	if err := json.Unmarshal(review.Request.Object.Raw, &pod); err != nil {
+		review.Response = admissionResponseWithError(fmt.Errorf("failed to unmarshal Pod: %v", err), review.Request.UID)
+	} else {
+		review.Response = mutatePod(&pod, wc.kubeClient, review.Request.UID)
+	}
+
+	response, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal AdmissionReview response: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(response); err != nil {
+		glog.Errorf("failed to write admission response: %v", err)
+	}
+}
+
+func admissionResponseWithError(err error, uid types.UID) *admissionv1beta1.AdmissionResponse {
+	return &admissionv1beta1.AdmissionResponse{
+		UID:     uid,
+		Allowed: false,
+		Result: &metav1.Status{
+			Message: err.Error(),
+		},
+	}
+}